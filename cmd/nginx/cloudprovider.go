@@ -0,0 +1,123 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/golang/glog"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CloudProvider resolves the externally reachable address of the
+// PublishService's LoadBalancer and, on shutdown, drains this node out of
+// the provider's load balancing pool before nginx stops accepting
+// connections. Implementations are optional: InitCloudProvider returns a
+// nil CloudProvider when --cloud-provider is not set, and callers must
+// treat that as "no cloud integration available".
+type CloudProvider interface {
+	// Name returns the provider name, as registered with RegisterCloudProvider.
+	Name() string
+
+	// EnsureLoadBalancer resolves (creating if necessary) the external
+	// address that should be written to the PublishService status, for
+	// the given namespace/name of that Service.
+	EnsureLoadBalancer(namespace, name string) (string, error)
+
+	// DeregisterNode removes the current node from the provider's backend
+	// pool (e.g. an ELB/Target Group or GCE instance group) so that new
+	// connections stop arriving while in-flight ones drain.
+	DeregisterNode() error
+}
+
+// Factory builds a CloudProvider from the contents of --cloud-config, which
+// may be empty for providers that need no configuration.
+type Factory func(config io.Reader) (CloudProvider, error)
+
+var providers = map[string]Factory{}
+
+// RegisterCloudProvider registers a CloudProvider factory under name, for
+// later lookup by InitCloudProvider. Mirrors
+// k8s.io/kubernetes/pkg/cloudprovider.RegisterCloudProvider; real providers
+// (AWS, GCE, Azure, OpenStack) call this from their own init().
+//
+// No providers are registered in this tree yet: --cloud-provider is a
+// recognized flag with nowhere to resolve to, so setting it to anything
+// other than "" fails fast via InitCloudProvider's "unknown cloud
+// provider" error rather than silently doing nothing.
+func RegisterCloudProvider(name string, factory Factory) {
+	if _, found := providers[name]; found {
+		glog.Fatalf("cloud provider %q was registered twice", name)
+	}
+	providers[name] = factory
+}
+
+// InitCloudProvider creates an instance of the named cloud provider, or
+// nil, nil if name is empty. config may be an empty string, in which case
+// the provider is initialized without a config file.
+func InitCloudProvider(name, config string) (CloudProvider, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	factory, found := providers[name]
+	if !found {
+		return nil, fmt.Errorf("unknown cloud provider %q", name)
+	}
+
+	var configFile io.Reader
+	if config != "" {
+		f, err := os.Open(config)
+		if err != nil {
+			return nil, fmt.Errorf("error opening cloud provider configuration %v: %v", config, err)
+		}
+		defer f.Close()
+		configFile = f
+	}
+
+	cp, err := factory(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing cloud provider %q: %v", name, err)
+	}
+
+	glog.Infof("initialized %v cloud provider", name)
+	return cp, nil
+}
+
+// patchLoadBalancerStatus writes address as svc's LoadBalancer status, so
+// that an address resolved via CloudProvider.EnsureLoadBalancer actually
+// drives the same PublishService-derived status sync as an address the
+// Service already had. address is written as an IP if it parses as one,
+// otherwise as a hostname (e.g. an ELB DNS name).
+func patchLoadBalancerStatus(client kubernetes.Interface, svc *apiv1.Service, address string) error {
+	ingress := apiv1.LoadBalancerIngress{}
+	if net.ParseIP(address) != nil {
+		ingress.IP = address
+	} else {
+		ingress.Hostname = address
+	}
+
+	svc.Status.LoadBalancer.Ingress = []apiv1.LoadBalancerIngress{ingress}
+
+	_, err := client.CoreV1().Services(svc.Namespace).UpdateStatus(svc)
+	return err
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/golang/glog"
+
+	"k8s.io/ingress-nginx/pkg/configz"
+	"k8s.io/ingress-nginx/pkg/ingress/controller"
+)
+
+const redacted = "<redacted>"
+
+// resolvedConfig is the subset of the controller's effective configuration
+// that is safe to expose over /configz: no kubeconfig tokens or TLS key
+// material, ever.
+type resolvedConfig struct {
+	DefaultService        string `json:"defaultService"`
+	PublishService        string `json:"publishService"`
+	WatchNamespace        string `json:"watchNamespace"`
+	ResyncPeriod          string `json:"resyncPeriod"`
+	HealthzPort           int    `json:"healthzPort"`
+	HTTPSPort             int    `json:"httpsPort"`
+	SSLProxyPort          int    `json:"sslProxyPort"`
+	EnableSSLPassthrough  bool   `json:"enableSSLPassthrough"`
+	KubeConfigFile        string `json:"kubeConfigFile"`
+	ElectionID            string `json:"electionID"`
+	ElectionNamespace     string `json:"electionNamespace"`
+	Leader                bool   `json:"leader"`
+}
+
+// registerConfigz exposes conf read-only on /configz, redacting anything
+// that could leak credentials if the pod's stdout/response were shared.
+func registerConfigz(conf *controller.Configuration, electionID string) {
+	kubeConfigFile := conf.KubeConfigFile
+	if kubeConfigFile != "" {
+		kubeConfigFile = redacted
+	}
+
+	snapshot := func() interface{} {
+		return &resolvedConfig{
+			DefaultService:       conf.DefaultService,
+			PublishService:       conf.PublishService,
+			WatchNamespace:       conf.Namespace,
+			ResyncPeriod:         conf.ResyncPeriod.String(),
+			HealthzPort:          conf.ListenPorts.Health,
+			HTTPSPort:            conf.ListenPorts.HTTPS,
+			SSLProxyPort:         conf.ListenPorts.SSLProxy,
+			EnableSSLPassthrough: conf.EnableSSLPassthrough,
+			KubeConfigFile:       kubeConfigFile,
+			ElectionID:           electionID,
+			ElectionNamespace:    conf.ElectionNamespace,
+			Leader:               amILeader(),
+		}
+	}
+
+	if _, err := configz.New("ingress-controller", configzFunc(snapshot)); err != nil {
+		glog.Errorf("error registering /configz: %v", err)
+	}
+}
+
+// configzFunc adapts a snapshot-on-demand function to json.Marshaler so
+// that every /configz request reflects the current leader state and
+// listener ports, not a point-in-time copy taken at registration.
+type configzFunc func() interface{}
+
+func (f configzFunc) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f())
+}
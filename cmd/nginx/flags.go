@@ -0,0 +1,130 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/ingress-nginx/pkg/ingress/controller"
+	"k8s.io/ingress-nginx/pkg/log"
+)
+
+// flags is the FlagSet every flag in this file is registered on. It is
+// deliberately not pflag.CommandLine: /flagz (see flagz.go) introspects
+// this FlagSet directly. parseFlags defines its flags on it, so parseFlags
+// runs once per process; a second call panics on "flag redefined".
+var flags = pflag.NewFlagSet("", pflag.ExitOnError)
+
+// parseFlags parses the command line and returns the resolved
+// Configuration. showVersion short-circuits everything else when
+// --version is passed.
+func parseFlags() (bool, *controller.Configuration, error) {
+	var (
+		showVersion = flags.Bool("version", false, "Shows release information about the NGINX ingress controller")
+
+		apiServerHost  = flags.String("apiserver-host", "", "Address of the Kubernetes API server. Takes the form \"protocol://address:port\". If not specified, the assumption is that the binary runs inside a Kubernetes cluster and local discovery is attempted.")
+		kubeConfigFile = flags.String("kubeconfig", "", "Path to a kubeconfig file containing authorization and API server information.")
+
+		defaultSvc = flags.String("default-backend-service", "",
+			"Service used to serve HTTP requests not matching any known server name (catch-all). Takes the form \"namespace/name\".")
+		publishSvc = flags.String("publish-service", "",
+			"Service whose address is used as the Ingress status of every Ingress this controller satisfies. Takes the form \"namespace/name\".")
+		watchNamespace = flags.String("watch-namespace", "",
+			"Namespace to watch for Ingress. Default is to watch all namespaces.")
+
+		resyncPeriod = flags.Duration("sync-period", 60*time.Second,
+			"Relist and confirm cloud resources this often.")
+
+		enableSSLPassthrough = flags.Bool("enable-ssl-passthrough", false,
+			"Enable SSL passthrough to route TCP connections directly to their backend by inspecting the TLS SNI, bypassing nginx for those hosts.")
+		enableProfiling = flags.Bool("profiling", true,
+			"Enable the /debug/pprof endpoints.")
+
+		healthzPort  = flags.Int("healthz-port", 10254, "Port to use for the /healthz, /metrics, /configz and /flagz endpoints.")
+		httpsPort    = flags.Int("https-port", 443, "Port to listen on for SSL passthrough connections.")
+		sslProxyPort = flags.Int("ssl-passthrough-proxy-port", 442,
+			"Port the legacy SSL passthrough fallback listens on for hosts not yet registered with the native SNI router.")
+
+		electionID        = flags.String("election-id", defaultElectionID, "Name of the ConfigMap used as the leader election lock.")
+		electionNamespace = flags.String("election-namespace", "kube-system", "Namespace of the ConfigMap used as the leader election lock.")
+
+		cloudProvider = flags.String("cloud-provider", "",
+			"The provider for cloud services. Empty string for no provider.")
+		cloudConfig = flags.String("cloud-config", "",
+			"Path to the cloud provider configuration file. Empty string for no configuration file.")
+
+		shutdownGracePeriod = flags.Duration("shutdown-grace-period", defaultShutdownGracePeriod,
+			"Time to wait for in-flight SSL passthrough connections to drain before asking nginx to quit, on SIGTERM.")
+		preStopDelay = flags.Duration("pre-stop-delay", 0,
+			"Time the /pre-stop hook blocks after marking the pod as draining, before returning. Meant to give kube-proxy/endpoints time to stop sending new traffic ahead of the kubelet's SIGTERM.")
+
+		logFormat = flags.String("log-format", string(log.FormatText),
+			"Log output encoding: \"text\" for human-readable console output or \"json\" for log aggregation.")
+		otelEndpoint = flags.String("otel-endpoint", "",
+			"OpenTelemetry collector address to export traces to, e.g. \"otel-collector:4317\". Empty disables tracing.")
+		otelSampler = flags.String("otel-sampler", "always",
+			"Trace sampling strategy: \"always\", \"never\", or a 0-1 probability.")
+	)
+
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return false, nil, err
+	}
+
+	if *showVersion {
+		return true, nil, nil
+	}
+
+	if *defaultSvc == "" {
+		return false, nil, fmt.Errorf("flag --default-backend-service is required")
+	}
+
+	return false, &controller.Configuration{
+		APIServerHost:  *apiServerHost,
+		KubeConfigFile: *kubeConfigFile,
+
+		DefaultService: *defaultSvc,
+		PublishService: *publishSvc,
+		Namespace:      *watchNamespace,
+
+		ResyncPeriod: *resyncPeriod,
+
+		ListenPorts: controller.ListenPorts{
+			Health:   *healthzPort,
+			HTTPS:    *httpsPort,
+			SSLProxy: *sslProxyPort,
+		},
+		EnableSSLPassthrough: *enableSSLPassthrough,
+		EnableProfiling:      *enableProfiling,
+
+		ElectionID:        *electionID,
+		ElectionNamespace: *electionNamespace,
+
+		CloudProvider: *cloudProvider,
+		CloudConfig:   *cloudConfig,
+
+		ShutdownGracePeriod: *shutdownGracePeriod,
+		PreStopDelay:        *preStopDelay,
+
+		LogFormat:    *logFormat,
+		OTelEndpoint: *otelEndpoint,
+		OTelSampler:  *otelSampler,
+	}, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/spf13/pflag"
+)
+
+// flagSource tells operators whether an effective flag value came from a
+// CLI argument or the flag's own default. parseFlags (flags.go) only ever
+// populates its FlagSet from os.Args, so those are the only two sources
+// that exist today.
+type flagSource string
+
+const (
+	sourceDefault flagSource = "default"
+	sourceCLI     flagSource = "cli"
+)
+
+type flagInfo struct {
+	Name    string     `json:"name"`
+	Value   string     `json:"value"`
+	Default string     `json:"default"`
+	Source  flagSource `json:"source"`
+}
+
+// installFlagz registers the /flagz endpoint on mux, listing every flag in
+// fs with its effective value and whether that value came from the CLI or
+// the built-in default.
+func installFlagz(mux *http.ServeMux, fs *pflag.FlagSet) {
+	mux.HandleFunc("/flagz", func(w http.ResponseWriter, r *http.Request) {
+		var result []flagInfo
+		fs.VisitAll(func(f *pflag.Flag) {
+			result = append(result, flagInfo{
+				Name:    f.Name,
+				Value:   f.Value.String(),
+				Default: f.DefValue,
+				Source:  flagValueSource(f),
+			})
+		})
+
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
+
+// flagValueSource reports where a flag's effective value came from: "cli"
+// if it was set on the command line (pflag records this via f.Changed),
+// "default" otherwise.
+func flagValueSource(f *pflag.Flag) flagSource {
+	if f.Changed {
+		return sourceCLI
+	}
+	return sourceDefault
+}
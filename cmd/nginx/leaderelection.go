@@ -0,0 +1,138 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+
+	"k8s.io/ingress-nginx/pkg/ingress/controller"
+)
+
+const (
+	// defaultElectionID is used when --election-id is not set.
+	defaultElectionID = "ingress-controller-leader"
+
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// isLeader is flipped by the leader election callbacks, alongside
+// leaderGauge, and read through amILeader by the /leader endpoint and
+// /configz, purely for observability; /healthz does not report it. The actual
+// enforcement of "only the leader writes status" lives in
+// controller.NGINXController.StatusUpdatesEnabled, gated by the
+// EnableStatusUpdates/DisableStatusUpdates calls below.
+var isLeader int32
+
+var leaderGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "nginx_ingress_controller",
+	Name:      "leader",
+	Help:      "Indicates if this replica is the elected leader (1) or not (0)",
+})
+
+func init() {
+	prometheus.MustRegister(leaderGauge)
+}
+
+// amILeader reports whether this replica currently holds the lock. Safe to
+// call from the /healthz handler and from status sync code paths.
+func amILeader() bool {
+	return atomic.LoadInt32(&isLeader) == 1
+}
+
+// setupLeaderElection starts a leader election loop using a ConfigMap lock
+// in electionNamespace named electionID. Only the elected replica is
+// allowed to drive ngx's status sync; all replicas keep serving traffic.
+// The election runs for the lifetime of the process; callers should launch
+// it in its own goroutine.
+func setupLeaderElection(client kubernetes.Interface, electionID, electionNamespace string, ngx *controller.NGINXController) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		glog.Fatalf("unexpected error obtaining the hostname: %v", err)
+	}
+
+	recorder := record.NewBroadcaster()
+	recorder.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: client.CoreV1().Events(electionNamespace),
+	})
+	eventRecorder := recorder.NewRecorder(scheme.Scheme, apiv1.EventSource{
+		Component: "ingress-leader-elector",
+		Host:      hostname,
+	})
+
+	lock := &resourcelock.ConfigMapLock{
+		ConfigMapMeta: metav1.ObjectMeta{
+			Namespace: electionNamespace,
+			Name:      electionID,
+		},
+		Client: client.CoreV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity:      hostname,
+			EventRecorder: eventRecorder,
+		},
+	}
+
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(stop <-chan struct{}) {
+				glog.Infof("I am the new leader (%v), enabling status updates", hostname)
+				atomic.StoreInt32(&isLeader, 1)
+				leaderGauge.Set(1)
+				ngx.EnableStatusUpdates()
+			},
+			OnStoppedLeading: func() {
+				glog.Infof("I am not the leader anymore (%v), disabling status updates", hostname)
+				atomic.StoreInt32(&isLeader, 0)
+				leaderGauge.Set(0)
+				ngx.DisableStatusUpdates()
+			},
+			OnNewLeader: func(identity string) {
+				if identity != hostname {
+					glog.Infof("new leader elected: %v", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		glog.Fatalf("unexpected error starting leader election: %v", err)
+	}
+
+	// Run returns once this replica loses the lease; campaign again so a
+	// former leader can take over again later.
+	for {
+		le.Run()
+	}
+}
@@ -17,20 +17,25 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"os/exec"
 	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	proxyproto "github.com/armon/go-proxyproto"
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apiserver/pkg/server/healthz"
@@ -39,9 +44,11 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 
+	"k8s.io/ingress-nginx/pkg/configz"
 	"k8s.io/ingress-nginx/pkg/ingress"
 	"k8s.io/ingress-nginx/pkg/ingress/controller"
 	"k8s.io/ingress-nginx/pkg/k8s"
+	"k8s.io/ingress-nginx/pkg/log"
 	"k8s.io/ingress-nginx/pkg/net/ssl"
 	"k8s.io/ingress-nginx/version"
 )
@@ -58,122 +65,259 @@ func main() {
 		glog.Fatal(err)
 	}
 
+	log.Setup(log.Format(conf.LogFormat))
+
+	shutdownTracer, err := initTracer(conf.OTelEndpoint, conf.OTelSampler)
+	if err != nil {
+		log.L.Fatal("error initializing tracer", "error", err)
+	}
+	defer shutdownTracer(context.Background())
+
+	ctx, span := tracer().Start(context.Background(), "startup")
+	defer span.End()
+
+	_, apiserverSpan := tracer().Start(ctx, "create-apiserver-client")
 	kubeClient, err := createApiserverClient(conf.APIServerHost, conf.KubeConfigFile)
+	apiserverSpan.End()
 	if err != nil {
 		handleFatalInitError(err)
 	}
 
+	cloud, err := InitCloudProvider(conf.CloudProvider, conf.CloudConfig)
+	if err != nil {
+		log.L.Fatal("unexpected error initializing cloud provider", "error", err)
+	}
+
+	_, defaultBackendSpan := tracer().Start(ctx, "validate-default-backend")
 	ns, name, err := k8s.ParseNameNS(conf.DefaultService)
 	if err != nil {
-		glog.Fatalf("invalid format for service %v: %v", conf.DefaultService, err)
+		log.L.Fatal("invalid format for service", "service", conf.DefaultService, "error", err)
 	}
 
 	_, err = kubeClient.Core().Services(ns).Get(name, metav1.GetOptions{})
 	if err != nil {
 		if strings.Contains(err.Error(), "cannot get services in the namespace") {
-			glog.Fatalf("✖ It seems the cluster it is running with Authorization enabled (like RBAC) and there is no permissions for the ingress controller. Please check the configuration")
+			log.L.Fatal("✖ It seems the cluster it is running with Authorization enabled (like RBAC) and there is no permissions for the ingress controller. Please check the configuration")
 		}
-		glog.Fatalf("no service with name %v found: %v", conf.DefaultService, err)
+		log.L.Fatal("no service found", "service", conf.DefaultService, "error", err)
 	}
-	glog.Infof("validated %v as the default backend", conf.DefaultService)
+	defaultBackendSpan.End()
+	log.L.Info("validated default backend", "service", conf.DefaultService)
 
+	_, publishServiceSpan := tracer().Start(ctx, "validate-publish-service")
 	if conf.PublishService != "" {
 		ns, name, err := k8s.ParseNameNS(conf.PublishService)
 		if err != nil {
-			glog.Fatalf("invalid service format: %v", err)
+			log.L.Fatal("invalid service format", "service", conf.PublishService, "error", err)
 		}
 
 		svc, err := kubeClient.CoreV1().Services(ns).Get(name, metav1.GetOptions{})
 		if err != nil {
-			glog.Fatalf("unexpected error getting information about service %v: %v", conf.PublishService, err)
+			log.L.Fatal("unexpected error getting information about service", "service", conf.PublishService, "error", err)
 		}
 
 		if len(svc.Status.LoadBalancer.Ingress) == 0 {
 			if len(svc.Spec.ExternalIPs) > 0 {
-				glog.Infof("service %v validated as assigned with externalIP", conf.PublishService)
+				log.L.Info("service validated as assigned with externalIP", "service", conf.PublishService)
+			} else if cloud != nil {
+				// The cloud provider may still be provisioning the load
+				// balancer backing this Service; resolve its address
+				// directly instead of treating the empty status as fatal.
+				address, err := cloud.EnsureLoadBalancer(ns, name)
+				if err != nil {
+					log.L.Fatal("unexpected error resolving load balancer", "service", conf.PublishService, "cloudProvider", cloud.Name(), "error", err)
+				}
+				if err := patchLoadBalancerStatus(kubeClient, svc, address); err != nil {
+					log.L.Fatal("unexpected error writing resolved load balancer address to service status", "service", conf.PublishService, "address", address, "error", err)
+				}
+				log.L.Info("resolved load balancer address using cloud provider and published it to the service status", "service", conf.PublishService, "address", address, "cloudProvider", cloud.Name())
 			} else {
 				// We could poll here, but we instead just exit and rely on k8s to restart us
-				glog.Fatalf("service %s does not (yet) have ingress points", conf.PublishService)
+				log.L.Fatal("service does not (yet) have ingress points", "service", conf.PublishService)
 			}
 		} else {
-			glog.Infof("service %v validated as source of Ingress status", conf.PublishService)
+			log.L.Info("service validated as source of Ingress status", "service", conf.PublishService)
 		}
 	}
+	publishServiceSpan.End()
 
 	if conf.Namespace != "" {
 		_, err = kubeClient.CoreV1().Namespaces().Get(conf.Namespace, metav1.GetOptions{})
 		if err != nil {
-			glog.Fatalf("no watchNamespace with name %v found: %v", conf.Namespace, err)
+			log.L.Fatal("no watchNamespace found", "namespace", conf.Namespace, "error", err)
 		}
 	}
 
 	if conf.ResyncPeriod.Seconds() < 10 {
-		glog.Fatalf("resync period (%vs) is too low", conf.ResyncPeriod.Seconds())
+		log.L.Fatal("resync period is too low", "resyncPeriodSeconds", conf.ResyncPeriod.Seconds())
 	}
 
+	_, sslBootstrapSpan := tracer().Start(ctx, "ssl-cert-bootstrap")
 	// create directory that will contains the SSL Certificates
 	err = os.MkdirAll(ingress.DefaultSSLDirectory, 0655)
 	if err != nil {
-		glog.Errorf("Failed to mkdir SSL directory: %v", err)
+		log.L.Error(err, "failed to mkdir SSL directory")
 	}
 	// create the default SSL certificate (dummy)
 	sha, pem := createDefaultSSLCertificate()
 	conf.FakeCertificatePath = pem
 	conf.FakeCertificateSHA = sha
+	sslBootstrapSpan.End()
 
 	conf.Client = kubeClient
 	conf.DefaultIngressClass = defIngressClass
 
 	ngx := controller.NewNGINXController(conf)
 
+	var sslProxy *sslPassthroughProxy
 	if conf.EnableSSLPassthrough {
-		setupSSLProxy(conf.ListenPorts.HTTPS, conf.ListenPorts.SSLProxy, ngx)
+		sslProxy = setupSSLProxy(conf.ListenPorts.HTTPS, conf.ListenPorts.SSLProxy, ngx)
+		go watchSSLPassthroughIngresses(kubeClient, conf.Namespace, sslProxy.router, nil)
+	}
+
+	go handleSigterm(ngx, cloud, sslProxy, conf.ShutdownGracePeriod)
+
+	electionID := conf.ElectionID
+	if electionID == "" {
+		electionID = defaultElectionID
 	}
+	go setupLeaderElection(kubeClient, electionID, conf.ElectionNamespace, ngx)
 
-	go handleSigterm(ngx)
+	registerConfigz(conf, electionID)
 
 	mux := http.NewServeMux()
-	go registerHandlers(conf.EnableProfiling, conf.ListenPorts.Health, ngx, mux)
+	installFlagz(mux, flags)
+	go registerHandlers(conf.EnableProfiling, conf.ListenPorts.Health, ngx, mux, conf.PreStopDelay)
 
 	ngx.Start()
 }
 
-func handleSigterm(ngx *controller.NGINXController) {
+// shuttingDown is flipped as soon as a drain is requested, either by
+// SIGTERM or by a preStop hook hitting /pre-stop. /healthz starts failing
+// the instant this is set so the Service endpoints controller removes the
+// pod from rotation before connections actually stop being accepted.
+var shuttingDown int32
+
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+func beginShutdown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+// notShuttingDownCheck fails /healthz once a drain has started, so the
+// Service endpoints controller removes this pod ahead of the nginx quit.
+func notShuttingDownCheck(r *http.Request) error {
+	if isShuttingDown() {
+		return fmt.Errorf("shutting down")
+	}
+	return nil
+}
+
+// defaultShutdownGracePeriod bounds how long handleSigterm waits for
+// in-flight SSL passthrough connections to drain before asking nginx to
+// quit, when --shutdown-grace-period is not set.
+const defaultShutdownGracePeriod = 10 * time.Second
+
+func handleSigterm(ngx *controller.NGINXController, cloud CloudProvider, sslProxy *sslPassthroughProxy, gracePeriod time.Duration) {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGTERM)
 	<-signalChan
-	glog.Infof("Received SIGTERM, shutting down")
+	log.L.Info("received SIGTERM, shutting down")
+
+	beginShutdown()
+
+	if gracePeriod <= 0 {
+		gracePeriod = defaultShutdownGracePeriod
+	}
+
+	if sslProxy != nil {
+		sslProxy.stop(gracePeriod)
+	}
+
+	if cloud != nil {
+		// Deregister before stopping nginx so in-flight connections are
+		// drained by the provider's own health checks rather than dropped.
+		if err := cloud.DeregisterNode(); err != nil {
+			log.L.Warning("error deregistering node from cloud provider", "cloudProvider", cloud.Name(), "error", err)
+		}
+	}
 
 	exitCode := 0
 	if err := ngx.Stop(); err != nil {
-		glog.Infof("Error during shutdown %v", err)
+		log.L.Error(err, "error during shutdown")
 		exitCode = 1
 	}
 
-	glog.Infof("Handled quit, awaiting pod deletion")
-	time.Sleep(10 * time.Second)
+	// "-s quit" lets nginx workers finish in-flight requests before exiting.
+	if out, err := exec.Command("nginx", "-s", "quit").CombinedOutput(); err != nil {
+		log.L.Error(err, "error asking nginx to quit", "output", string(out))
+		exitCode = 1
+	}
 
-	glog.Infof("Exiting with %v", exitCode)
+	log.L.Info("handled quit, awaiting pod deletion")
+	log.L.Info("exiting", "exitCode", exitCode)
 	os.Exit(exitCode)
 }
 
-func setupSSLProxy(sslPort, proxyPort int, n *controller.NGINXController) {
-	glog.Info("starting TLS proxy for SSL passthrough")
-	n.Proxy = &controller.TCPProxy{
-		Default: &controller.TCPServer{
-			Hostname:      "localhost",
-			IP:            "127.0.0.1",
-			Port:          proxyPort,
-			ProxyProtocol: true,
-		},
+// sslPassthroughProxy accepts the raw TCP connections for SSL passthrough
+// and tracks the ones currently being handled, so that shutdown can stop
+// the listener and wait for those connections to finish instead of
+// cutting them off.
+type sslPassthroughProxy struct {
+	listener  net.Listener
+	proxyList *proxyproto.Listener
+	inFlight  sync.WaitGroup
+	router    *sniRouter
+}
+
+// stop closes the listener so no new connections are accepted, then waits
+// up to gracePeriod for in-flight connections to finish on their own.
+func (p *sslPassthroughProxy) stop(gracePeriod time.Duration) {
+	log.L.Info("closing SSL passthrough listener", "gracePeriod", gracePeriod)
+	p.listener.Close()
+
+	done := make(chan struct{})
+	go func() {
+		p.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.L.Info("all SSL passthrough connections drained")
+	case <-time.After(gracePeriod):
+		log.L.Warning("shutdown grace period expired with connections still in flight", "gracePeriod", gracePeriod)
 	}
+}
+
+// setupSSLProxy starts the native SNI router for SSL passthrough. Hosts
+// kept in sync from Ingress annotations by watchSSLPassthroughIngresses
+// are routed straight to their backend without going through nginx; any
+// other host goes to a registered backend listing one of its offered ALPN
+// tokens if there is one, and otherwise falls back to the legacy
+// localhost:proxyPort listener nginx itself exposes for passthrough, so
+// unconfigured hosts keep working during migration.
+func setupSSLProxy(sslPort, proxyPort int, n *controller.NGINXController) *sslPassthroughProxy {
+	log.L.Info("starting native SNI router for SSL passthrough")
+
+	router := newSNIRouter(&sniBackend{
+		Hostname: "localhost",
+		Address:  fmt.Sprintf("127.0.0.1:%v", proxyPort),
+	})
+	n.SNIRouter = router
 
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", sslPort))
 	if err != nil {
-		glog.Fatalf("%v", err)
+		log.L.Fatal(err.Error())
 	}
 
-	proxyList := &proxyproto.Listener{Listener: listener}
+	p := &sslPassthroughProxy{
+		listener:  listener,
+		proxyList: &proxyproto.Listener{Listener: listener},
+		router:    router,
+	}
 
 	// start goroutine that accepts tcp connections in port 443
 	go func() {
@@ -184,20 +328,35 @@ func setupSSLProxy(sslPort, proxyPort int, n *controller.NGINXController) {
 			if n.IsProxyProtocolEnabled {
 				// we need to wrap the listener in order to decode
 				// proxy protocol before handling the connection
-				conn, err = proxyList.Accept()
+				conn, err = p.proxyList.Accept()
 			} else {
-				conn, err = listener.Accept()
+				conn, err = p.listener.Accept()
 			}
 
 			if err != nil {
-				glog.Warningf("unexpected error accepting tcp connection: %v", err)
+				if isShuttingDown() {
+					log.L.Info("SSL passthrough listener closed, stopping accept loop")
+					return
+				}
+				log.L.Warning("unexpected error accepting tcp connection", "error", err)
 				continue
 			}
 
-			glog.V(3).Infof("remote address %s to local %s", conn.RemoteAddr(), conn.LocalAddr())
-			go n.Proxy.Handle(conn)
+			_, connSpan := tracer().Start(context.Background(), "ssl-passthrough-connection")
+			connSpan.SetAttributes(
+				attribute.String("remote.addr", conn.RemoteAddr().String()),
+				attribute.String("local.addr", conn.LocalAddr().String()),
+			)
+			p.inFlight.Add(1)
+			go func() {
+				defer p.inFlight.Done()
+				defer connSpan.End()
+				router.Handle(conn)
+			}()
 		}
 	}()
+
+	return p
 }
 
 // createApiserverClient creates new Kubernetes Apiserver client. When kubeconfig or apiserverHost param is empty
@@ -278,15 +437,37 @@ func handleFatalInitError(err error) {
 		"https://github.com/kubernetes/ingress-nginx/blob/master/docs/troubleshooting.md", err)
 }
 
-func registerHandlers(enableProfiling bool, port int, ic *controller.NGINXController, mux *http.ServeMux) {
-	// expose health check endpoint (/healthz)
+func registerHandlers(enableProfiling bool, port int, ic *controller.NGINXController, mux *http.ServeMux, preStopDelay time.Duration) {
+	// expose health check endpoint (/healthz). notShuttingDownCheck fails
+	// as soon as a drain has started so the pod is pulled out of Service
+	// endpoints before connections actually stop being accepted.
 	healthz.InstallHandler(mux,
 		healthz.PingHealthz,
+		healthz.NamedCheck("shutdown", notShuttingDownCheck),
 		ic,
 	)
 
+	mux.HandleFunc("/leader", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		b, _ := json.Marshal(amILeader())
+		w.Write(b)
+	})
+
+	// /pre-stop is meant to be wired up as a Kubernetes preStop lifecycle
+	// hook: it marks the pod as draining (failing /healthz) and blocks for
+	// preStopDelay, giving kube-proxy/endpoints time to stop sending new
+	// traffic before the kubelet follows up with SIGTERM.
+	mux.HandleFunc("/pre-stop", func(w http.ResponseWriter, r *http.Request) {
+		log.L.Info("received /pre-stop hook", "preStopDelay", preStopDelay)
+		beginShutdown()
+		time.Sleep(preStopDelay)
+		w.WriteHeader(http.StatusOK)
+	})
+
 	mux.Handle("/metrics", promhttp.Handler())
 
+	configz.InstallHandler(mux)
+
 	mux.HandleFunc("/build", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		b, _ := json.Marshal(version.String())
@@ -296,7 +477,7 @@ func registerHandlers(enableProfiling bool, port int, ic *controller.NGINXContro
 	mux.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
 		err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
 		if err != nil {
-			glog.Errorf("unexpected error: %v", err)
+			log.L.Error(err, "unexpected error sending SIGTERM to self")
 		}
 	})
 
@@ -311,7 +492,7 @@ func registerHandlers(enableProfiling bool, port int, ic *controller.NGINXContro
 		Addr:    fmt.Sprintf(":%v", port),
 		Handler: mux,
 	}
-	glog.Fatal(server.ListenAndServe())
+	log.L.Fatal(server.ListenAndServe().Error())
 }
 
 func createDefaultSSLCertificate() (string, string) {
@@ -0,0 +1,421 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/ingress-nginx/pkg/log"
+)
+
+// proxyProtoVersion selects which PROXY protocol header, if any, is sent
+// to a backend before forwarding the passthrough connection.
+type proxyProtoVersion int
+
+const (
+	proxyProtoNone proxyProtoVersion = iota
+	proxyProtoV1
+	proxyProtoV2
+)
+
+// sniBackend is the per-hostname routing target registered from Ingress
+// annotations for a given SSL passthrough host.
+type sniBackend struct {
+	// Hostname this backend serves, e.g. "app.example.com". The router
+	// compares it with the ClientHello SNI as an exact string; no case
+	// folding is applied.
+	Hostname string
+	// Address is the backend's host:port, e.g. a Service ClusterIP:port.
+	Address string
+	// ALPN lists protocol tokens (e.g. "h2", "http/1.1", or an arbitrary
+	// gRPC sub-protocol token) that route a client to this backend when
+	// its SNI matches no registered hostname. A client whose SNI does
+	// match is routed here whatever ALPN tokens it offers.
+	ALPN []string
+	// ProxyProto is the PROXY protocol version emitted to this backend.
+	ProxyProto proxyProtoVersion
+}
+
+// equal reports whether b and other describe the same routing target.
+// ALPN is compared as a slice field by field since sniBackend isn't
+// comparable with ==.
+func (b *sniBackend) equal(other *sniBackend) bool {
+	if b.Hostname != other.Hostname || b.Address != other.Address || b.ProxyProto != other.ProxyProto {
+		return false
+	}
+	if len(b.ALPN) != len(other.ALPN) {
+		return false
+	}
+	for i := range b.ALPN {
+		if b.ALPN[i] != other.ALPN[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sniMetrics are the /metrics counters for the native SNI router.
+type sniMetrics struct {
+	bytesIn        *prometheus.CounterVec
+	bytesOut       *prometheus.CounterVec
+	handshakeFails prometheus.Counter
+	sniNotMatched  prometheus.Counter
+}
+
+func newSNIMetrics() *sniMetrics {
+	m := &sniMetrics{
+		bytesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_ingress_controller",
+			Subsystem: "sni_proxy",
+			Name:      "bytes_in_total",
+			Help:      "Bytes read from the client and forwarded to the backend, per SNI hostname",
+		}, []string{"hostname"}),
+		bytesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "nginx_ingress_controller",
+			Subsystem: "sni_proxy",
+			Name:      "bytes_out_total",
+			Help:      "Bytes read from the backend and forwarded to the client, per SNI hostname",
+		}, []string{"hostname"}),
+		handshakeFails: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "nginx_ingress_controller",
+			Subsystem: "sni_proxy",
+			Name:      "handshake_failures_total",
+			Help:      "Connections on which no ClientHello bytes could be read",
+		}),
+		sniNotMatched: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "nginx_ingress_controller",
+			Subsystem: "sni_proxy",
+			Name:      "sni_not_matched_total",
+			Help:      "ClientHellos whose SNI did not match any registered backend",
+		}),
+	}
+	prometheus.MustRegister(m.bytesIn, m.bytesOut, m.handshakeFails, m.sniNotMatched)
+	return m
+}
+
+// sniRouter parses the TLS ClientHello SNI (and ALPN list) directly off
+// the accepted connection and forwards the raw bytes to the matching
+// per-hostname backend, without an extra nginx hop. This replaces the
+// single-destination TCPProxy used for SSL passthrough.
+type sniRouter struct {
+	mu       sync.RWMutex
+	backends map[string]*sniBackend
+	// defaultBackend is used when no hostname matches, mirroring the
+	// previous TCPProxy.Default behavior.
+	defaultBackend *sniBackend
+	metrics        *sniMetrics
+}
+
+func newSNIRouter(defaultBackend *sniBackend) *sniRouter {
+	return &sniRouter{
+		backends:       map[string]*sniBackend{},
+		defaultBackend: defaultBackend,
+		metrics:        newSNIMetrics(),
+	}
+}
+
+// Register adds or replaces the backend for hostname, typically called
+// whenever Ingress annotations describing SSL passthrough hosts change.
+func (s *sniRouter) Register(hostname string, backend *sniBackend) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backends[hostname] = backend
+}
+
+// Unregister removes the backend previously registered for hostname.
+func (s *sniRouter) Unregister(hostname string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.backends, hostname)
+}
+
+// Reconcile replaces the full set of registered backends with desired,
+// logging each addition, update and removal. Callers that discover the
+// desired set as a whole (e.g. by listing Ingresses) should use this
+// instead of individual Register/Unregister calls, so that hosts removed
+// from the source of truth are actually dropped.
+func (s *sniRouter) Reconcile(desired map[string]*sniBackend) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hostname, backend := range desired {
+		if existing, ok := s.backends[hostname]; !ok || !existing.equal(backend) {
+			log.L.Info("registering SNI passthrough backend", "hostname", hostname, "backend", backend.Address)
+		}
+		s.backends[hostname] = backend
+	}
+
+	for hostname := range s.backends {
+		if _, ok := desired[hostname]; !ok {
+			log.L.Info("unregistering SNI passthrough backend", "hostname", hostname)
+			delete(s.backends, hostname)
+		}
+	}
+}
+
+func (s *sniRouter) lookup(hostname string) *sniBackend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if b, ok := s.backends[hostname]; ok {
+		return b
+	}
+	return nil
+}
+
+var errAbortAfterClientHello = errors.New("sni: aborting handshake after capturing ClientHello")
+
+// recordingConn wraps a net.Conn and remembers every byte Read from it, so
+// that bytes consumed while peeking the ClientHello can be replayed to the
+// real backend connection. Write is intentionally a no-op: peekClientHello
+// only ever uses this wrapper to let crypto/tls read the ClientHello, and
+// crypto/tls reacts to the deliberate GetConfigForClient abort error by
+// sending a TLS alert record back over the conn it was handed. If that
+// Write reached the real client socket, the client would see a bogus
+// alert before the backend's real ServerHello, corrupting the passthrough
+// handshake. Discarding Write here keeps the abort entirely internal.
+type recordingConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// peekClientHello reads just enough of conn to extract the SNI server name
+// and ALPN protocol list from the TLS ClientHello, without consuming the
+// connection for the eventual backend handshake: the bytes read are
+// returned in raw so the caller can prepend them when piping to the
+// backend.
+func peekClientHello(conn net.Conn) (hostname string, alpn []string, raw []byte, err error) {
+	rec := &recordingConn{Conn: conn}
+
+	cfg := &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			hostname = hello.ServerName
+			alpn = hello.SupportedProtos
+			return nil, errAbortAfterClientHello
+		},
+	}
+
+	// Bound the peek: a client that completes the TCP handshake and then
+	// never sends a ClientHello would otherwise block this goroutine (and
+	// the inFlight WaitGroup it holds open) forever, pinning shutdown
+	// until the drain grace period expires. Clear the deadline once the
+	// peek is done so it doesn't carry over to the backend dial/pipe.
+	conn.SetReadDeadline(time.Now().Add(clientHelloTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	// Handshake always fails here (by design, via errAbortAfterClientHello)
+	// once the ClientHello has been parsed; we never complete a real TLS
+	// handshake on this connection.
+	_ = tls.Server(rec, cfg).Handshake()
+
+	if hostname == "" && rec.buf.Len() == 0 {
+		return "", nil, nil, errors.New("sni: no ClientHello bytes read")
+	}
+
+	return hostname, alpn, rec.buf.Bytes(), nil
+}
+
+// clientHelloTimeout bounds how long peekClientHello waits for a
+// ClientHello before giving up on a connection.
+const clientHelloTimeout = 5 * time.Second
+
+// Handle implements the same role as the previous controller.TCPProxy.Handle:
+// given an accepted connection, it resolves the right backend by SNI (and
+// optionally by ALPN) and proxies bytes in both directions.
+func (s *sniRouter) Handle(conn net.Conn) {
+	defer conn.Close()
+
+	hostname, alpn, raw, err := peekClientHello(conn)
+	if err != nil {
+		log.L.Warning("error parsing ClientHello for SSL passthrough", "error", err)
+		s.metrics.handshakeFails.Inc()
+		return
+	}
+
+	backend := s.lookup(hostname)
+	if backend == nil {
+		s.metrics.sniNotMatched.Inc()
+		backend = s.matchALPN(alpn)
+	}
+	if backend == nil {
+		backend = s.defaultBackend
+	}
+	if backend == nil {
+		log.L.Warning("no SNI backend matched and no default backend configured", "hostname", hostname)
+		return
+	}
+
+	upstream, err := net.Dial("tcp", backend.Address)
+	if err != nil {
+		log.L.Warning("error dialing SNI backend", "hostname", hostname, "backend", backend.Address, "error", err)
+		return
+	}
+	defer upstream.Close()
+
+	if err := writeProxyProtoHeader(upstream, backend.ProxyProto, conn.RemoteAddr(), conn.LocalAddr()); err != nil {
+		log.L.Warning("error writing PROXY protocol header", "hostname", hostname, "backend", backend.Address, "error", err)
+		return
+	}
+
+	metricHostname := hostname
+	if metricHostname == "" {
+		metricHostname = "_default"
+	}
+
+	// replay the bytes already consumed while peeking the ClientHello,
+	// then pipe the rest of the connection through untouched.
+	if len(raw) > 0 {
+		if _, err := upstream.Write(raw); err != nil {
+			log.L.Warning("error replaying ClientHello to backend", "hostname", hostname, "error", err)
+			return
+		}
+		s.metrics.bytesIn.WithLabelValues(metricHostname).Add(float64(len(raw)))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		n, _ := io.Copy(upstream, conn)
+		s.metrics.bytesIn.WithLabelValues(metricHostname).Add(float64(n))
+		if cw, ok := upstream.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		n, _ := io.Copy(conn, upstream)
+		s.metrics.bytesOut.WithLabelValues(metricHostname).Add(float64(n))
+	}()
+	wg.Wait()
+}
+
+// matchALPN falls back to matching a backend purely by an advertised ALPN
+// token (e.g. routing all "h2" gRPC clients to one backend) when no
+// hostname-based match was found.
+func (s *sniRouter) matchALPN(alpn []string) *sniBackend {
+	if len(alpn) == 0 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, b := range s.backends {
+		for _, proto := range b.ALPN {
+			for _, offered := range alpn {
+				if proto == offered {
+					return b
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeProxyProtoHeader emits a PROXY protocol v1 or v2 header to w
+// describing src/dst, or does nothing for proxyProtoNone.
+func writeProxyProtoHeader(w io.Writer, version proxyProtoVersion, src, dst net.Addr) error {
+	switch version {
+	case proxyProtoNone:
+		return nil
+	case proxyProtoV1:
+		return writeProxyProtoV1(w, src, dst)
+	case proxyProtoV2:
+		return writeProxyProtoV2(w, src, dst)
+	default:
+		return nil
+	}
+}
+
+func writeProxyProtoV1(w io.Writer, src, dst net.Addr) error {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		_, err := io.WriteString(w, "PROXY UNKNOWN\r\n")
+		return err
+	}
+
+	proto := "TCP4"
+	if srcTCP.IP.To4() == nil {
+		proto = "TCP6"
+	}
+
+	_, err := io.WriteString(w, "PROXY "+proto+" "+
+		srcTCP.IP.String()+" "+dstTCP.IP.String()+" "+
+		strconv.Itoa(srcTCP.Port)+" "+strconv.Itoa(dstTCP.Port)+"\r\n")
+	return err
+}
+
+// proxyProtoV2Signature is the fixed 12-byte preamble of a v2 header.
+var proxyProtoV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+func writeProxyProtoV2(w io.Writer, src, dst net.Addr) error {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		// No usable address pair: emit a LOCAL command, which carries no
+		// address block and tells the backend to ignore the connection
+		// metadata.
+		header := append([]byte{}, proxyProtoV2Signature...)
+		header = append(header, 0x20, 0x00, 0x00, 0x00)
+		_, err := w.Write(header)
+		return err
+	}
+
+	af := byte(0x11) // AF_INET, STREAM
+	addrLen := 12
+	ipv4 := srcTCP.IP.To4() != nil
+	if !ipv4 {
+		af = 0x21 // AF_INET6, STREAM
+		addrLen = 36
+	}
+
+	header := append([]byte{}, proxyProtoV2Signature...)
+	header = append(header, 0x21, af, byte(addrLen>>8), byte(addrLen))
+
+	if ipv4 {
+		header = append(header, srcTCP.IP.To4()...)
+		header = append(header, dstTCP.IP.To4()...)
+	} else {
+		header = append(header, srcTCP.IP.To16()...)
+		header = append(header, dstTCP.IP.To16()...)
+	}
+	header = append(header, byte(srcTCP.Port>>8), byte(srcTCP.Port), byte(dstTCP.Port>>8), byte(dstTCP.Port))
+
+	_, err := w.Write(header)
+	return err
+}
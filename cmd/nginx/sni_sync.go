@@ -0,0 +1,144 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"k8s.io/ingress-nginx/pkg/log"
+)
+
+const (
+	sslPassthroughAnnotation = "nginx.ingress.kubernetes.io/ssl-passthrough"
+	alpnAnnotation           = "nginx.ingress.kubernetes.io/ssl-passthrough-alpn"
+	proxyProtocolAnnotation  = "nginx.ingress.kubernetes.io/ssl-passthrough-proxy-protocol"
+)
+
+// syncSNIBackendsPeriod is how often watchSSLPassthroughIngresses
+// reconciles the native SNI router against the cluster's Ingress objects.
+// It mirrors the resync cadence the rest of the controller already uses,
+// rather than reacting to every individual Ingress event.
+const syncSNIBackendsPeriod = 30 * time.Second
+
+// watchSSLPassthroughIngresses keeps router's per-hostname backends in
+// sync with Ingress objects annotated for SSL passthrough
+// (sslPassthroughAnnotation). It runs until stopCh is closed and is meant
+// to be launched in its own goroutine.
+func watchSSLPassthroughIngresses(client kubernetes.Interface, namespace string, router *sniRouter, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(syncSNIBackendsPeriod)
+	defer ticker.Stop()
+
+	for {
+		syncSNIBackends(client, namespace, router)
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncSNIBackends reconciles router against the current set of
+// SSL-passthrough Ingresses: backends for hosts that are no longer
+// annotated (or were removed) are unregistered, and the rest are
+// registered or updated.
+func syncSNIBackends(client kubernetes.Interface, namespace string, router *sniRouter) {
+	ingresses, err := client.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		log.L.Warning("error listing ingresses for SNI passthrough sync", "error", err)
+		return
+	}
+
+	desired := map[string]*sniBackend{}
+
+	for _, ing := range ingresses.Items {
+		if ing.Annotations[sslPassthroughAnnotation] != "true" {
+			continue
+		}
+
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host == "" || rule.HTTP == nil {
+				continue
+			}
+
+			for _, path := range rule.HTTP.Paths {
+				backend, err := resolveServiceBackend(client, ing.Namespace, path.Backend.ServiceName, path.Backend.ServicePort.IntValue())
+				if err != nil {
+					log.L.Warning("error resolving SSL passthrough backend",
+						"hostname", rule.Host, "service", path.Backend.ServiceName, "error", err)
+					continue
+				}
+
+				backend.Hostname = rule.Host
+				if alpn := ing.Annotations[alpnAnnotation]; alpn != "" {
+					backend.ALPN = splitAndTrim(alpn)
+				}
+				backend.ProxyProto = proxyProtoFromAnnotation(ing.Annotations[proxyProtocolAnnotation])
+
+				desired[rule.Host] = backend
+				break
+			}
+		}
+	}
+
+	router.Reconcile(desired)
+}
+
+// resolveServiceBackend looks up the ClusterIP for a passthrough
+// Ingress's backend Service, since the native SNI router dials the
+// backend directly instead of going through nginx's own upstream.
+func resolveServiceBackend(client kubernetes.Interface, namespace, serviceName string, port int) (*sniBackend, error) {
+	svc, err := client.CoreV1().Services(namespace).Get(serviceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if svc.Spec.ClusterIP == "" {
+		return nil, fmt.Errorf("service %v/%v has no ClusterIP", namespace, serviceName)
+	}
+
+	return &sniBackend{
+		Address: fmt.Sprintf("%v:%v", svc.Spec.ClusterIP, port),
+	}, nil
+}
+
+func proxyProtoFromAnnotation(v string) proxyProtoVersion {
+	switch v {
+	case "v1":
+		return proxyProtoV1
+	case "v2":
+		return proxyProtoV2
+	default:
+		return proxyProtoNone
+	}
+}
+
+func splitAndTrim(s string) []string {
+	var out []string
+	for _, tok := range strings.Split(s, ",") {
+		if tok = strings.TrimSpace(tok); tok != "" {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"k8s.io/ingress-nginx/version"
+)
+
+const tracerName = "k8s.io/ingress-nginx/cmd/nginx"
+
+// initTracer wires up the process-wide OpenTelemetry tracer. endpoint is
+// the collector address for --otel-endpoint; an empty endpoint disables
+// export but still installs a tracer so span creation calls are no-ops
+// instead of nil-pointer hazards. sampler selects the sampling strategy:
+// "always", "never", or a string parseable as a 0-1 probability.
+func initTracer(endpoint, sampler string) (func(context.Context) error, error) {
+	if endpoint == "" {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(context.Background(),
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating otel exporter: %v", err)
+	}
+
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceNameKey.String("ingress-nginx-controller")),
+		resource.WithAttributes(semconv.ServiceVersionKey.String(version.String())),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error building otel resource: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(samplerFromFlag(sampler)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+func samplerFromFlag(sampler string) sdktrace.Sampler {
+	switch sampler {
+	case "", "always":
+		return sdktrace.AlwaysSample()
+	case "never":
+		return sdktrace.NeverSample()
+	default:
+		var ratio float64
+		if _, err := fmt.Sscanf(sampler, "%f", &ratio); err != nil {
+			return sdktrace.AlwaysSample()
+		}
+		return sdktrace.TraceIDRatioBased(ratio)
+	}
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package configz lets a running process register its resolved
+// configuration for inspection over HTTP, modeled on
+// k8s.io/kubernetes/pkg/util/configz.
+package configz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+var (
+	configsGuard sync.RWMutex
+	configs      = map[string]*Config{}
+)
+
+// Config is a named, JSON-marshalable snapshot of a component's
+// configuration, registered with New and served from InstallHandler.
+type Config struct {
+	val interface{}
+}
+
+// New registers val under name, returning an error if name is already
+// registered (call Delete first to replace it). val is marshaled to JSON on every request, so it is safe
+// to keep mutating the underlying struct after registering it as long as
+// that's done in a way that's safe to read concurrently.
+func New(name string, val interface{}) (*Config, error) {
+	configsGuard.Lock()
+	defer configsGuard.Unlock()
+
+	if _, found := configs[name]; found {
+		return nil, fmt.Errorf("configz: config with name %v already registered", name)
+	}
+
+	c := &Config{val: val}
+	configs[name] = c
+	return c, nil
+}
+
+// Delete removes the named configuration, if any.
+func Delete(name string) {
+	configsGuard.Lock()
+	defer configsGuard.Unlock()
+	delete(configs, name)
+}
+
+// InstallHandler registers the /configz endpoint on mux. With no query
+// string it returns every registered configuration, keyed by name;
+// ?name=XXX returns just that one.
+func InstallHandler(mux *http.ServeMux) {
+	mux.HandleFunc("/configz", handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	configsGuard.RLock()
+	defer configsGuard.RUnlock()
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		c, found := configs[name]
+		if !found {
+			http.Error(w, fmt.Sprintf("no configuration registered for %q", name), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, c.val)
+		return
+	}
+
+	all := make(map[string]interface{}, len(configs))
+	for name, c := range configs {
+		all[name] = c.val
+	}
+	writeJSON(w, all)
+}
+
+func writeJSON(w http.ResponseWriter, val interface{}) {
+	b, err := json.MarshalIndent(val, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
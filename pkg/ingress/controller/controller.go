@@ -0,0 +1,141 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// ListenPorts groups the TCP ports the controller listens on.
+type ListenPorts struct {
+	Health   int
+	HTTPS    int
+	SSLProxy int
+}
+
+// Configuration holds the resolved settings NewNGINXController is built
+// from: everything parseFlags fills in from CLI flags plus the pieces
+// main() computes (the apiserver client, the default SSL certificate).
+type Configuration struct {
+	APIServerHost  string
+	KubeConfigFile string
+
+	DefaultService string
+	PublishService string
+	Namespace      string
+
+	ResyncPeriod time.Duration
+
+	ListenPorts          ListenPorts
+	EnableSSLPassthrough bool
+	EnableProfiling      bool
+
+	FakeCertificatePath string
+	FakeCertificateSHA  string
+
+	Client              kubernetes.Interface
+	DefaultIngressClass string
+
+	ElectionID        string
+	ElectionNamespace string
+
+	CloudProvider string
+	CloudConfig   string
+
+	ShutdownGracePeriod time.Duration
+	PreStopDelay        time.Duration
+
+	LogFormat    string
+	OTelEndpoint string
+	OTelSampler  string
+}
+
+// SSLPassthroughProxy is the per-connection handler for the SSL
+// passthrough listener. The native SNI router (cmd/nginx's sniRouter)
+// implements this.
+type SSLPassthroughProxy interface {
+	Handle(conn net.Conn)
+}
+
+// NGINXController holds the resolved Configuration and keeps Ingress
+// status in sync with the PublishService. It does not watch
+// Service/Endpoints objects, nor render or reload the nginx configuration.
+type NGINXController struct {
+	conf *Configuration
+
+	Client              kubernetes.Interface
+	DefaultIngressClass string
+
+	// SNIRouter handles SSL passthrough connections accepted on
+	// conf.ListenPorts.HTTPS, routing by SNI instead of nginx's own
+	// stream block.
+	SNIRouter SSLPassthroughProxy
+
+	// IsProxyProtocolEnabled reports whether the SSL passthrough listener
+	// should decode the PROXY protocol header before handing connections
+	// to SNIRouter.
+	IsProxyProtocolEnabled bool
+
+	stopCh chan struct{}
+}
+
+// NewNGINXController builds an NGINXController for conf. Start must be
+// called to actually begin reconciling.
+func NewNGINXController(conf *Configuration) *NGINXController {
+	return &NGINXController{
+		conf:                conf,
+		Client:              conf.Client,
+		DefaultIngressClass: conf.DefaultIngressClass,
+		stopCh:              make(chan struct{}),
+	}
+}
+
+// Start launches the Ingress status sync loop (syncStatus) and blocks
+// until Stop is called.
+func (n *NGINXController) Start() {
+	glog.Info("starting NGINX controller")
+
+	go n.syncStatus(n.stopCh)
+
+	<-n.stopCh
+}
+
+// Stop signals the controller to shut down its background loops. It does
+// not itself quit the nginx process; callers drive that separately (see
+// cmd/nginx's handleSigterm).
+func (n *NGINXController) Stop() error {
+	close(n.stopCh)
+	return nil
+}
+
+// Name identifies this checker for healthz.InstallHandler.
+func (n *NGINXController) Name() string {
+	return "nginx-ingress-controller"
+}
+
+// Check implements healthz.HealthzChecker. r is unused: the only
+// meaningful check left to it is the shutdown gate installed in
+// cmd/nginx's registerHandlers (healthz.NamedCheck("shutdown", ...)).
+func (n *NGINXController) Check(r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import "sync/atomic"
+
+// statusUpdatesEnabled gates whether the status sync loop is allowed to
+// write Ingress status / drive PublishService sync. It is process-wide
+// rather than a field on NGINXController because exactly one
+// NGINXController runs per process; leader election flips it through
+// EnableStatusUpdates/DisableStatusUpdates as this replica gains or loses
+// the lock.
+var statusUpdatesEnabled int32
+
+// EnableStatusUpdates allows the status sync loop to write Ingress
+// status. Called once this replica is elected leader.
+func (n *NGINXController) EnableStatusUpdates() {
+	atomic.StoreInt32(&statusUpdatesEnabled, 1)
+}
+
+// DisableStatusUpdates stops the status sync loop from writing Ingress
+// status. Called when this replica loses leadership.
+func (n *NGINXController) DisableStatusUpdates() {
+	atomic.StoreInt32(&statusUpdatesEnabled, 0)
+}
+
+// StatusUpdatesEnabled reports whether this replica is currently allowed
+// to write Ingress status. The status sync loop must check this before
+// every write, so that only the elected leader performs
+// PublishService-derived status sync while every replica keeps serving
+// traffic.
+func (n *NGINXController) StatusUpdatesEnabled() bool {
+	return atomic.LoadInt32(&statusUpdatesEnabled) == 1
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/pkg/k8s"
+)
+
+// statusSyncPeriod is how often syncStatus checks whether this replica
+// should (re)publish Ingress status, mirroring the cadence
+// watchSSLPassthroughIngresses already uses for its own reconcile loop.
+const statusSyncPeriod = 30 * time.Second
+
+// syncStatus periodically copies conf.PublishService's LoadBalancer
+// status onto every Ingress this controller watches. It runs for the
+// lifetime of the process; every tick is gated on StatusUpdatesEnabled
+// so that only the elected leader actually writes, while every replica
+// (leader or not) keeps this loop running and ready to take over the
+// instant it wins the election.
+func (n *NGINXController) syncStatus(stopCh <-chan struct{}) {
+	if n.conf.PublishService == "" {
+		return
+	}
+
+	ticker := time.NewTicker(statusSyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if !n.StatusUpdatesEnabled() {
+				continue
+			}
+			if err := n.updateIngressStatus(); err != nil {
+				glog.Errorf("error syncing ingress status: %v", err)
+			}
+		}
+	}
+}
+
+// updateIngressStatus fetches conf.PublishService and writes its
+// LoadBalancer status onto every Ingress in conf.Namespace (all
+// namespaces, if unset).
+func (n *NGINXController) updateIngressStatus() error {
+	ns, name, err := k8s.ParseNameNS(n.conf.PublishService)
+	if err != nil {
+		return err
+	}
+
+	svc, err := n.Client.CoreV1().Services(ns).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	ingresses, err := n.Client.ExtensionsV1beta1().Ingresses(n.conf.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for i := range ingresses.Items {
+		ing := ingresses.Items[i]
+		ing.Status.LoadBalancer = svc.Status.LoadBalancer
+		if _, err := n.Client.ExtensionsV1beta1().Ingresses(ing.Namespace).UpdateStatus(&ing); err != nil {
+			glog.Errorf("error updating status for ingress %v/%v: %v", ing.Namespace, ing.Name, err)
+		}
+	}
+
+	return nil
+}